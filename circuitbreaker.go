@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreakerState is the state of a per-backend circuit breaker.
+type circuitBreakerState int
+
+const (
+	circuitClosed circuitBreakerState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker tracks a rolling error rate for a backend and trips it
+// (marking it dead) once that rate crosses a threshold, recovering it via
+// a single half-open probe after a cool-down period.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	windowSize     int
+	errorThreshold float64
+	cooldown       time.Duration
+
+	results []bool // ring buffer of recent outcomes; true == success
+	idx     int
+	filled  int
+
+	state            circuitBreakerState
+	openedAt         time.Time
+	halfOpenInFlight bool
+}
+
+// newCircuitBreaker creates a circuitBreaker with the given rolling window
+// size, trip threshold (fraction of failures in [0,1]), and cool-down
+// period before a half-open probe is allowed.
+func newCircuitBreaker(windowSize int, errorThreshold float64, cooldown time.Duration) *circuitBreaker {
+	if windowSize <= 0 {
+		windowSize = 1
+	}
+	return &circuitBreaker{
+		windowSize:     windowSize,
+		errorThreshold: errorThreshold,
+		cooldown:       cooldown,
+		results:        make([]bool, windowSize),
+	}
+}
+
+// probeReady reports whether a half-open probe could be admitted right
+// now, without actually admitting one. It's a pure peek for backend
+// selection (e.g. a Strategy deciding whether a tripped backend is even a
+// candidate) and must not be used as a substitute for admitHalfOpenProbe.
+func (cb *circuitBreaker) probeReady() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state == circuitOpen && !cb.halfOpenInFlight && time.Since(cb.openedAt) >= cb.cooldown
+}
+
+// admitHalfOpenProbe reports whether the caller is the one allowed to send
+// a single probe request through an open circuit now that its cool-down
+// has elapsed, and if so reserves the slot so no other caller is also
+// admitted. Only call this for the backend a request is actually about to
+// be forwarded to.
+func (cb *circuitBreaker) admitHalfOpenProbe() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != circuitOpen {
+		return false
+	}
+	if time.Since(cb.openedAt) < cb.cooldown {
+		return false
+	}
+	if cb.halfOpenInFlight {
+		return false
+	}
+
+	cb.halfOpenInFlight = true
+	cb.state = circuitHalfOpen
+	return true
+}
+
+// circuitTransition describes how record changed the breaker's state.
+type circuitTransition int
+
+const (
+	transitionNone circuitTransition = iota
+	transitionTripped
+	transitionClosed
+)
+
+// record folds a request outcome into the rolling window, tripping or
+// resetting the breaker as appropriate.
+func (cb *circuitBreaker) record(success bool) circuitTransition {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		cb.halfOpenInFlight = false
+		if success {
+			cb.reset()
+			return transitionClosed
+		}
+		cb.trip()
+		return transitionTripped
+	}
+
+	cb.results[cb.idx] = success
+	cb.idx = (cb.idx + 1) % cb.windowSize
+	if cb.filled < cb.windowSize {
+		cb.filled++
+	}
+
+	if cb.state == circuitOpen {
+		return transitionNone
+	}
+	if cb.filled < cb.windowSize {
+		return transitionNone
+	}
+
+	failures := 0
+	for _, ok := range cb.results[:cb.filled] {
+		if !ok {
+			failures++
+		}
+	}
+	if float64(failures)/float64(cb.filled) >= cb.errorThreshold {
+		cb.trip()
+		return transitionTripped
+	}
+
+	return transitionNone
+}
+
+// trip opens the circuit; callers hold cb.mu.
+func (cb *circuitBreaker) trip() {
+	cb.state = circuitOpen
+	cb.openedAt = time.Now()
+}
+
+// reset closes the circuit and clears its rolling window; callers hold cb.mu.
+func (cb *circuitBreaker) reset() {
+	cb.state = circuitClosed
+	cb.idx = 0
+	cb.filled = 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAtErrorThreshold(t *testing.T) {
+	cb := newCircuitBreaker(4, 0.5, time.Minute)
+
+	if got := cb.record(true); got != transitionNone {
+		t.Fatalf("record(true) = %v, want transitionNone", got)
+	}
+	if got := cb.record(true); got != transitionNone {
+		t.Fatalf("record(true) = %v, want transitionNone", got)
+	}
+	if got := cb.record(false); got != transitionNone {
+		t.Fatalf("record(false) = %v, want transitionNone (window not full yet)", got)
+	}
+	// Window is now full (4 results: true, true, false, false) at exactly
+	// 50% failures, meeting the >= threshold.
+	if got := cb.record(false); got != transitionTripped {
+		t.Fatalf("record(false) = %v, want transitionTripped", got)
+	}
+	if cb.state != circuitOpen {
+		t.Fatalf("state = %v, want circuitOpen", cb.state)
+	}
+}
+
+func TestCircuitBreakerStaysClosedBelowThreshold(t *testing.T) {
+	cb := newCircuitBreaker(4, 0.5, time.Minute)
+
+	results := []bool{true, true, true, false}
+	var last circuitTransition
+	for _, r := range results {
+		last = cb.record(r)
+	}
+	if last != transitionNone {
+		t.Fatalf("record() = %v, want transitionNone (only 25%% failures)", last)
+	}
+	if cb.state != circuitClosed {
+		t.Fatalf("state = %v, want circuitClosed", cb.state)
+	}
+}
+
+func TestCircuitBreakerProbeNotReadyBeforeCooldown(t *testing.T) {
+	cb := newCircuitBreaker(2, 0.5, time.Hour)
+	cb.record(false)
+	cb.record(false)
+	if cb.state != circuitOpen {
+		t.Fatalf("state = %v, want circuitOpen", cb.state)
+	}
+
+	if cb.probeReady() {
+		t.Fatal("probeReady() = true before cooldown elapsed, want false")
+	}
+	if cb.admitHalfOpenProbe() {
+		t.Fatal("admitHalfOpenProbe() = true before cooldown elapsed, want false")
+	}
+}
+
+func TestCircuitBreakerAdmitsSingleProbeAfterCooldown(t *testing.T) {
+	cb := newCircuitBreaker(2, 0.5, time.Millisecond)
+	cb.record(false)
+	cb.record(false)
+	time.Sleep(5 * time.Millisecond)
+
+	if !cb.probeReady() {
+		t.Fatal("probeReady() = false after cooldown elapsed, want true")
+	}
+	if !cb.admitHalfOpenProbe() {
+		t.Fatal("admitHalfOpenProbe() = false on first call after cooldown, want true")
+	}
+	// probeReady and a second admission attempt must both report false:
+	// only one probe may be in flight at a time.
+	if cb.probeReady() {
+		t.Fatal("probeReady() = true while a probe is already in flight, want false")
+	}
+	if cb.admitHalfOpenProbe() {
+		t.Fatal("admitHalfOpenProbe() = true on second call, want false (slot already reserved)")
+	}
+}
+
+func TestCircuitBreakerRecordClosesOnSuccessfulProbe(t *testing.T) {
+	cb := newCircuitBreaker(2, 0.5, time.Millisecond)
+	cb.record(false)
+	cb.record(false)
+	time.Sleep(5 * time.Millisecond)
+	if !cb.admitHalfOpenProbe() {
+		t.Fatal("admitHalfOpenProbe() = false, want true")
+	}
+
+	if got := cb.record(true); got != transitionClosed {
+		t.Fatalf("record(true) in half-open = %v, want transitionClosed", got)
+	}
+	if cb.state != circuitClosed {
+		t.Fatalf("state = %v, want circuitClosed", cb.state)
+	}
+	if cb.probeReady() {
+		t.Fatal("probeReady() = true for a closed breaker, want false")
+	}
+}
+
+func TestCircuitBreakerRecordReopensOnFailedProbe(t *testing.T) {
+	cb := newCircuitBreaker(2, 0.5, time.Millisecond)
+	cb.record(false)
+	cb.record(false)
+	time.Sleep(5 * time.Millisecond)
+	if !cb.admitHalfOpenProbe() {
+		t.Fatal("admitHalfOpenProbe() = false, want true")
+	}
+
+	if got := cb.record(false); got != transitionTripped {
+		t.Fatalf("record(false) in half-open = %v, want transitionTripped", got)
+	}
+	if cb.state != circuitOpen {
+		t.Fatalf("state = %v, want circuitOpen", cb.state)
+	}
+	if cb.halfOpenInFlight {
+		t.Fatal("halfOpenInFlight = true after record, want false")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BackendConfig describes one backend server.
+type BackendConfig struct {
+	URL             string            `json:"url" yaml:"url"`
+	Weight          int               `json:"weight,omitempty" yaml:"weight,omitempty"`
+	HealthCheckPath string            `json:"health_check_path,omitempty" yaml:"health_check_path,omitempty"`
+	MaxConns        int               `json:"max_conns,omitempty" yaml:"max_conns,omitempty"`
+	TLS             *BackendTLSConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// BackendTLSConfig describes how the load balancer authenticates to a
+// backend over HTTPS, independent of the front-end's own TLS termination.
+type BackendTLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// HealthCheckConfig describes the active health-checking parameters shared
+// by every backend.
+type HealthCheckConfig struct {
+	Path                 string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Interval             Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout              Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Rise                 int      `json:"rise,omitempty" yaml:"rise,omitempty"`
+	Fall                 int      `json:"fall,omitempty" yaml:"fall,omitempty"`
+	PassiveFailThreshold int      `json:"passive_fail_threshold,omitempty" yaml:"passive_fail_threshold,omitempty"`
+}
+
+// TLSConfig describes the front-end listener's TLS termination. Either a
+// static CertFile/KeyFile pair or AutoCert may be configured, but not both.
+type TLSConfig struct {
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+
+	AutoCert *AutoCertConfig `json:"auto_cert,omitempty" yaml:"auto_cert,omitempty"`
+
+	// HTTPRedirectAddr, if set, starts a plain-HTTP listener that redirects
+	// every request to the HTTPS front end.
+	HTTPRedirectAddr string `json:"http_redirect_addr,omitempty" yaml:"http_redirect_addr,omitempty"`
+}
+
+// AutoCertConfig describes automatic certificate issuance via Let's
+// Encrypt (golang.org/x/crypto/acme/autocert).
+type AutoCertConfig struct {
+	Hosts    []string `json:"hosts" yaml:"hosts"`
+	CacheDir string   `json:"cache_dir,omitempty" yaml:"cache_dir,omitempty"`
+}
+
+// RetryConfig describes how a forwarding failure is retried against
+// another backend.
+type RetryConfig struct {
+	MaxAttempts       int      `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	PerAttemptTimeout Duration `json:"per_attempt_timeout,omitempty" yaml:"per_attempt_timeout,omitempty"`
+	RetryableStatuses []int    `json:"retryable_statuses,omitempty" yaml:"retryable_statuses,omitempty"`
+	MaxBufferBytes    int64    `json:"max_buffer_bytes,omitempty" yaml:"max_buffer_bytes,omitempty"`
+}
+
+// CircuitBreakerConfig describes the per-backend rolling error-rate
+// breaker.
+type CircuitBreakerConfig struct {
+	WindowSize     int      `json:"window_size,omitempty" yaml:"window_size,omitempty"`
+	ErrorThreshold float64  `json:"error_threshold,omitempty" yaml:"error_threshold,omitempty"`
+	Cooldown       Duration `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+}
+
+// Duration wraps time.Duration so config fields can be set from either a
+// human-readable string ("30s", "2m") or a raw nanosecond integer in both
+// JSON and YAML config files. Plain time.Duration unmarshals from JSON
+// numbers only, which would make the same "interval": "30s" value that
+// yaml.v3 already accepts fail to parse as JSON.
+type Duration time.Duration
+
+// UnmarshalJSON accepts either a duration string or a nanosecond integer.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("parsing duration %q: %w", v, err)
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(int64(v))
+	default:
+		return fmt.Errorf("invalid duration: %v", raw)
+	}
+	return nil
+}
+
+// MarshalJSON renders the duration in its human-readable form.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalYAML accepts either a duration string or a nanosecond integer,
+// matching UnmarshalJSON's behavior (yaml.v3 already accepts a duration
+// string for a plain time.Duration field, but loses that ability once the
+// field's type is Duration instead).
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var n int64
+	if err := value.Decode(&n); err == nil {
+		*d = Duration(n)
+		return nil
+	}
+
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid duration: %s", value.Value)
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("parsing duration %q: %w", raw, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config is the top-level load balancer configuration, loadable from JSON
+// or YAML.
+type Config struct {
+	ListenAddr     string               `json:"listen_addr" yaml:"listen_addr"`
+	AdminAddr      string               `json:"admin_addr,omitempty" yaml:"admin_addr,omitempty"`
+	TLS            *TLSConfig           `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Strategy       string               `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	Persistence    string               `json:"persistence,omitempty" yaml:"persistence,omitempty"`
+	TrustedProxies []string             `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+	HealthCheck    HealthCheckConfig    `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	Retry          RetryConfig          `json:"retry,omitempty" yaml:"retry,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker,omitempty" yaml:"circuit_breaker,omitempty"`
+	Backends       []BackendConfig      `json:"backends" yaml:"backends"`
+}
+
+// defaultConfig returns the configuration used when no --config file is
+// given, matching the load balancer's historical hardcoded defaults.
+func defaultConfig() *Config {
+	return &Config{
+		ListenAddr: ":8080",
+		AdminAddr:  ":9090",
+		Strategy:   "round-robin",
+		HealthCheck: HealthCheckConfig{
+			Path:     "/",
+			Interval: Duration(time.Minute),
+			Timeout:  Duration(2 * time.Second),
+			Rise:     1,
+			Fall:     1,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:       1,
+			PerAttemptTimeout: Duration(5 * time.Second),
+			RetryableStatuses: []int{502, 503, 504},
+			MaxBufferBytes:    1 << 20, // 1 MiB
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			WindowSize:     20,
+			ErrorThreshold: 0.5,
+			Cooldown:       Duration(30 * time.Second),
+		},
+		Backends: []BackendConfig{
+			{URL: "http://localhost:8081"},
+			{URL: "http://localhost:8082"},
+			{URL: "http://localhost:8083"},
+		},
+	}
+}
+
+// Load reads a Config from path, detecting JSON vs YAML from the file
+// extension (.json, or .yaml/.yml).
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	cfg := &Config{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing JSON config: %w", err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing YAML config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config extension: %s", ext)
+	}
+
+	return cfg, nil
+}
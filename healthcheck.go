@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// HealthChecker determines whether a backend is currently healthy.
+type HealthChecker interface {
+	Check(b *Backend) bool
+}
+
+// ================================== TCP =============================== ///
+
+// TCPHealthChecker checks a backend by dialing its host.
+type TCPHealthChecker struct {
+	Timeout time.Duration
+}
+
+// NewTCPHealthChecker creates a TCPHealthChecker with the given dial timeout.
+func NewTCPHealthChecker(timeout time.Duration) *TCPHealthChecker {
+	return &TCPHealthChecker{Timeout: timeout}
+}
+
+// Check dials the backend's host and reports whether the connection succeeded.
+func (c *TCPHealthChecker) Check(b *Backend) bool {
+	conn, err := net.DialTimeout("tcp", b.URL.Host, c.Timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return true
+}
+
+// ================================== HTTP =============================== ///
+
+// HTTPHealthChecker checks a backend by issuing an HTTP GET and validating
+// the response status against an allowed range.
+type HTTPHealthChecker struct {
+	// Path is the request path used when a backend has no HealthCheckPath
+	// of its own.
+	Path string
+	// MinStatus and MaxStatus bound the accepted response status range,
+	// inclusive. Defaults to 200-399 when both are zero.
+	MinStatus, MaxStatus int
+	// Host, if set, is sent as the request's Host header.
+	Host string
+	// Headers are added to every health-check request.
+	Headers http.Header
+
+	client *http.Client
+}
+
+// NewHTTPHealthChecker creates an HTTPHealthChecker with the given default
+// path and per-request timeout.
+func NewHTTPHealthChecker(path string, timeout time.Duration) *HTTPHealthChecker {
+	return &HTTPHealthChecker{
+		Path:      path,
+		MinStatus: http.StatusOK,
+		MaxStatus: 399,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Check issues an HTTP GET against the backend's health-check path and
+// reports whether the response status falls within the accepted range.
+func (c *HTTPHealthChecker) Check(b *Backend) bool {
+	path := c.Path
+	if b.HealthCheckPath != "" {
+		path = b.HealthCheckPath
+	}
+
+	u := *b.URL
+	u.Path = path
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	if c.Host != "" {
+		req.Host = c.Host
+	}
+	for name, values := range c.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	client := c.client
+	if b.Transport != nil {
+		// Reuse the same RoundTripper the reverse proxy forwards requests
+		// with, so a backend that needs a custom CA, InsecureSkipVerify,
+		// or mTLS to be reachable at all doesn't fail active health
+		// checks while the reverse proxy reaches it fine.
+		client = &http.Client{Timeout: c.client.Timeout, Transport: b.Transport}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	min, max := c.MinStatus, c.MaxStatus
+	if min == 0 && max == 0 {
+		min, max = http.StatusOK, 399
+	}
+	return resp.StatusCode >= min && resp.StatusCode <= max
+}
+
+// ================================== RISE/FALL =============================== ///
+
+// recordCheckResult folds an active health-check result into the backend's
+// rise/fall counters and flips Alive only after RiseThreshold consecutive
+// successes (to go up) or FallThreshold consecutive failures (to go down).
+// A passing check always resets the passive failure counter.
+func (b *Backend) recordCheckResult(success bool) bool {
+	rise := b.RiseThreshold
+	if rise <= 0 {
+		rise = 1
+	}
+	fall := b.FallThreshold
+	if fall <= 0 {
+		fall = 1
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if success {
+		b.consecutiveFailures = 0
+		b.consecutiveSuccesses++
+		if b.consecutiveSuccesses >= rise {
+			b.Alive = true
+		}
+	} else {
+		b.consecutiveSuccesses = 0
+		b.consecutiveFailures++
+		if b.consecutiveFailures >= fall {
+			b.Alive = false
+		}
+	}
+
+	if success {
+		atomic.StoreInt64(&b.passiveFailures, 0)
+	}
+
+	return b.Alive
+}
+
+// recordPassiveFailure increments the passive failure counter maintained
+// from the reverse proxy's error handler. Once it reaches
+// PassiveFailThreshold, the backend is marked dead immediately, without
+// waiting for the next active health-check tick.
+func (b *Backend) recordPassiveFailure() {
+	threshold := b.PassiveFailThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	if atomic.AddInt64(&b.passiveFailures, 1) >= int64(threshold) {
+		b.SetAlive(false)
+	}
+}
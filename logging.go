@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// logger emits one structured JSON line per request, in addition to the
+// operational logging scattered through the rest of the package.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+type requestMetricsKeyType struct{}
+
+var requestMetricsKey requestMetricsKeyType
+
+// requestMetrics carries the backend a request was ultimately forwarded to
+// out of LoadBalancer.ServeHTTP, for the logging/metrics middleware to
+// label its series and log line with.
+type requestMetrics struct {
+	backend string
+}
+
+// withRequestMetrics attaches a fresh requestMetrics to ctx.
+func withRequestMetrics(ctx context.Context) (context.Context, *requestMetrics) {
+	rm := &requestMetrics{}
+	return context.WithValue(ctx, requestMetricsKey, rm), rm
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code written
+// to it, defaulting to 200 if WriteHeader is never called explicitly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.status = http.StatusOK
+		r.wroteHeader = true
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying ResponseWriter's Flusher, if it
+// has one. Without this, wrapping every request in a statusRecorder would
+// hide the Flusher the reverse proxy type-asserts for, silently buffering
+// streaming responses (SSE, chunked long-poll) instead of flushing them
+// incrementally.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying ResponseWriter's Hijacker, if it
+// has one, so handlers that need a raw connection (e.g. WebSocket upgrades)
+// still work through the logging middleware.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// remoteIP returns the client IP from a request's RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loggingMiddleware records Prometheus request metrics and emits one
+// structured JSON log line per request.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		ctx, rm := withRequestMetrics(r.Context())
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		backendLabel := rm.backend
+		if backendLabel == "" {
+			backendLabel = "none"
+		}
+
+		requestsTotal.WithLabelValues(backendLabel, strconv.Itoa(rec.status), r.Method).Inc()
+		requestDuration.WithLabelValues(backendLabel, r.Method).Observe(duration.Seconds())
+
+		logger.Info("request",
+			"backend", backendLabel,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", duration.Milliseconds(),
+			"client_ip", remoteIP(r),
+		)
+	})
+}
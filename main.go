@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,8 +21,51 @@ import (
 type Backend struct {
 	URL          *url.URL
 	Alive        bool
+	Weight       int
 	mux          sync.RWMutex
 	ReverseProxy *httputil.ReverseProxy
+
+	// currentWeight is mutated by WeightedRoundRobinStrategy between picks.
+	currentWeight int
+
+	// ActiveConnections tracks in-flight requests for least-connections.
+	ActiveConnections int64
+
+	// MaxConns caps the number of in-flight requests this backend will be
+	// selected for. Zero or negative means no cap.
+	MaxConns int
+
+	// HealthCheckPath overrides the HealthChecker's default path for this
+	// backend, e.g. when it serves its health endpoint somewhere other
+	// than the shared default.
+	HealthCheckPath string
+
+	// Transport is the RoundTripper used to reach this backend, carrying
+	// its TLS settings (custom CA, client certs, InsecureSkipVerify). It
+	// backs both ReverseProxy and any HTTPHealthChecker, so active health
+	// checks see the backend the same way the reverse proxy does. Nil
+	// means the default transport.
+	Transport http.RoundTripper
+
+	// RiseThreshold and FallThreshold are the number of consecutive
+	// successful/failed active health checks required before a backend
+	// flips alive/dead. Values <= 1 check on every result.
+	RiseThreshold int
+	FallThreshold int
+
+	// PassiveFailThreshold is the number of consecutive reverse-proxy
+	// errors that trip a backend dead without waiting for the next active
+	// health check. Zero disables passive health checking.
+	PassiveFailThreshold int
+
+	consecutiveSuccesses int
+	consecutiveFailures  int
+	passiveFailures      int64
+
+	// breaker trips the backend out of rotation when its rolling error
+	// rate gets too high, independently of active health checks. Nil
+	// disables circuit breaking.
+	breaker *circuitBreaker
 }
 
 // SetAlive updates the alive status of a backend
@@ -28,57 +75,178 @@ func (b *Backend) SetAlive(alive bool) {
 	b.mux.Unlock()
 }
 
-// IsAlive returns true when backend is Alive
+// rawAlive reports the backend's actual Alive flag, without the
+// probe-readiness fallback IsAlive applies for a tripped-but-probe-ready
+// breaker. Use this where a true/false health state must be carried over
+// as-is, e.g. across a config reload, rather than treated as selectable.
+func (b *Backend) rawAlive() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.Alive
+}
+
+// IsAlive reports whether backend is currently a selectable candidate:
+// either Alive, or tripped with a circuit breaker that's ready to admit a
+// half-open probe. It's a pure read with no side effects, safe to call
+// from Strategy/Persistence scans that don't go on to forward a request.
+// Selecting a backend based on IsAlive does not by itself consume the
+// breaker's probe slot; call AdmitProbe on the backend a request is
+// actually about to be sent to.
 func (b *Backend) IsAlive() (alive bool) {
 	b.mux.RLock()
 	alive = b.Alive
 	b.mux.RUnlock()
-	return
+	if alive {
+		return true
+	}
+	if b.breaker != nil {
+		return b.breaker.probeReady()
+	}
+	return false
+}
+
+// HasCapacity reports whether backend can currently accept another
+// request, honoring MaxConns. A zero or negative MaxConns means no cap.
+func (b *Backend) HasCapacity() bool {
+	if b.MaxConns <= 0 {
+		return true
+	}
+	return atomic.LoadInt64(&b.ActiveConnections) < int64(b.MaxConns)
+}
+
+// AdmitProbe reports whether this backend may actually receive the
+// request that's about to be forwarded. For an Alive backend this is
+// always true. For a tripped backend it reserves the circuit breaker's
+// single half-open probe slot, so it must only be called once per request
+// for the backend actually chosen to handle it, never during selection
+// scans.
+func (b *Backend) AdmitProbe() bool {
+	b.mux.RLock()
+	alive := b.Alive
+	b.mux.RUnlock()
+	if alive {
+		return true
+	}
+	if b.breaker != nil {
+		return b.breaker.admitHalfOpenProbe()
+	}
+	return false
+}
+
+// recordRequestResult folds a forwarded request's outcome into the
+// backend's circuit breaker, tripping or closing it as appropriate.
+func (b *Backend) recordRequestResult(success bool) {
+	if !success {
+		backendErrorsTotal.WithLabelValues(b.URL.Host).Inc()
+	}
+
+	if b.breaker == nil {
+		return
+	}
+	switch b.breaker.record(success) {
+	case transitionTripped:
+		b.SetAlive(false)
+		setBackendUp(b.URL.Host, false)
+	case transitionClosed:
+		b.SetAlive(true)
+		setBackendUp(b.URL.Host, true)
+	}
 }
 
 // LoadBalancer represents a load balancer
 type LoadBalancer struct {
-	backends []*Backend
-	current  uint64
+	mux           sync.RWMutex
+	backends      []*Backend
+	strategy      Strategy
+	persistence   Persistence
+	healthChecker HealthChecker
+	retryPolicy   *retryPolicy
+
+	// cookieSecret signs sticky-session cookies and is kept stable across
+	// config reloads so existing cookies stay valid.
+	cookieSecret []byte
 }
 
-// NextBackend returns the next available backend to handle the request
-func (lb *LoadBalancer) NextBackend() *Backend {
-	// simple round-robin
-	next := atomic.AddUint64(&lb.current, uint64(1)) % uint64(len(lb.backends))
-	// Find the next available backend
-	for i := 0; i < len(lb.backends); i++ {
-		idx := (int(next) + i) % len(lb.backends)
-		if lb.backends[idx].IsAlive() {
-			return lb.backends[idx]
-		}
+// NextBackend returns the next available backend to handle the request,
+// as chosen by the load balancer's configured Strategy. Backends present
+// as keys in excluded (e.g. ones a retry already tried) are never
+// returned.
+func (lb *LoadBalancer) NextBackend(r *http.Request, excluded map[*Backend]bool) *Backend {
+	lb.mux.RLock()
+	strategy := lb.strategy
+	lb.mux.RUnlock()
+	if strategy == nil {
+		return nil
 	}
-	return nil
+	return strategy.Pick(r, excluded)
 }
 
-// ================================== HEALTH CHECKING =============================== ///
-// isBackendAlive checks whether a backend is alive by establishing a TCP connection
-func isBackendAlive(u *url.URL) bool {
-	timeout := 2 * time.Second
-	conn, err := net.DialTimeout("tcp", u.Host, timeout)
-	if err != nil {
-		log.Printf("Site unreachable: %s", err)
-		return false
+// newStrategy builds a Strategy by name over the given backends.
+func newStrategy(name string, backends []*Backend) (Strategy, error) {
+	switch name {
+	case "round-robin", "":
+		return NewRoundRobinStrategy(backends), nil
+	case "weighted-round-robin":
+		return NewWeightedRoundRobinStrategy(backends), nil
+	case "least-connections":
+		return NewLeastConnectionsStrategy(backends), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy: %s", name)
+	}
+}
+
+// newPersistence builds a Persistence by name, or nil if name is empty.
+func newPersistence(name string, trustedProxies []net.IP, cookieSecret []byte) (Persistence, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "source-ip":
+		return NewSourceIPPersistence(trustedProxies), nil
+	case "cookie":
+		return NewCookiePersistence(cookieSecret, 24*time.Hour), nil
+	default:
+		return nil, fmt.Errorf("unknown persistence mode: %s", name)
 	}
+}
 
-	defer conn.Close()
-	return true
+// parseTrustedProxies parses a list of IP strings, as found in Config's
+// TrustedProxies field or a comma-separated --trusted-proxies flag.
+func parseTrustedProxies(hosts []string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, s := range hosts {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy IP: %s", s)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
 }
 
-// HealthCheck pings the backend and updates thier status
+// ================================== HEALTH CHECKING =============================== ///
+
+// HealthCheck runs the load balancer's HealthChecker against every backend
+// and folds the result into its rise/fall counters.
 func (lb *LoadBalancer) HealthCheck() {
-	for _, b := range lb.backends {
-		status := isBackendAlive(b.URL)
-		b.SetAlive(status)
-		if status {
-			log.Printf("Backend %s is alive", b.URL)
-		} else {
-			log.Printf("Backend %s is dead", b.URL)
+	lb.mux.RLock()
+	backends := lb.backends
+	checker := lb.healthChecker
+	lb.mux.RUnlock()
+
+	for _, b := range backends {
+		wasAlive := b.IsAlive()
+		status := b.recordCheckResult(checker.Check(b))
+		setBackendUp(b.URL.Host, status)
+		if status != wasAlive {
+			if status {
+				logger.Info("backend alive", "backend", b.URL.String())
+			} else {
+				logger.Warn("backend dead", "backend", b.URL.String())
+			}
 		}
 	}
 }
@@ -97,68 +265,200 @@ func (lb *LoadBalancer) HealthCheckPeriodically(interval time.Duration) {
 // ================================== HTTP HANDLER =============================== ///
 // ServeHTTP implements the http.Handler interface for the LoadBalancer
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	backend := lb.NextBackend()
-	if backend == nil {
-		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
-		return
+	lb.mux.RLock()
+	backends := lb.backends
+	persistence := lb.persistence
+	policy := lb.retryPolicy
+	lb.mux.RUnlock()
+
+	maxAttempts := 1
+	var body io.ReadSeeker
+	if policy != nil {
+		maxAttempts = policy.attempts()
+		if maxAttempts > 1 {
+			buffered, ok := bufferedBody(r, policy.MaxBufferBytes)
+			if !ok {
+				maxAttempts = 1
+			} else {
+				body = buffered
+			}
+		}
 	}
-	// Forward the request to the backend
-	backend.ReverseProxy.ServeHTTP(w, r)
+
+	var backend *Backend
+	if persistence != nil {
+		backend = persistence.Get(r, backends)
+	}
+
+	rm, _ := r.Context().Value(requestMetricsKey).(*requestMetrics)
+
+	tried := make(map[*Backend]bool, maxAttempts)
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; {
+		if backend == nil || tried[backend] {
+			backend = lb.NextBackend(r, tried)
+		}
+		if backend == nil {
+			break
+		}
+		if !backend.AdmitProbe() {
+			// Lost the race for a tripped backend's single half-open
+			// probe slot (or it's simply still down): it's not a usable
+			// candidate, so exclude it and pick again without spending
+			// one of our retry attempts.
+			tried[backend] = true
+			backend = nil
+			continue
+		}
+		tried[backend] = true
+		if attempt == 0 && persistence != nil {
+			persistence.Assign(w, r, backend)
+		}
+		if rm != nil {
+			rm.backend = backend.URL.Host
+		}
+
+		ctx := context.WithValue(r.Context(), attemptKey, attempt)
+		ctx, outcome := withOutcome(ctx)
+		if policy != nil && policy.PerAttemptTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, policy.PerAttemptTimeout)
+			defer cancel()
+		}
+		attemptReq := attemptRequest(r, ctx, body)
+
+		conns := atomic.AddInt64(&backend.ActiveConnections, 1)
+		setActiveConnections(backend.URL.Host, conns)
+		backend.ReverseProxy.ServeHTTP(w, attemptReq)
+		conns = atomic.AddInt64(&backend.ActiveConnections, -1)
+		setActiveConnections(backend.URL.Host, conns)
+
+		attempt++
+		if outcome.err == nil {
+			return
+		}
+		lastErr = outcome.err
+		backend = nil
+	}
+
+	if lastErr != nil {
+		logger.Error("all backend attempts failed", "error", lastErr.Error())
+	}
+	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 }
 
 // ================================== MAIN PROGRAM =============================== ///
 func main() {
 	// Parse command line flags
-	port := flag.Int("port", 8080, "Port to serve on")
+	configPath := flag.String("config", "", "Path to a JSON or YAML config file (default: built-in defaults)")
+	certPath := flag.String("cert", "", "Path to a TLS certificate file (enables HTTPS termination)")
+	keyPath := flag.String("key", "", "Path to the TLS certificate's private key")
 	flag.Parse()
 
-	// Configure backends
-	serverList := []string{
-		"http://localhost:8081",
-		"http://localhost:8082",
-		"http://localhost:8083",
-	}
-
-	// create Load balancer
-	lb := LoadBalancer{}
-
-	// initialize backends
-	for _, serverURL := range serverList {
-		url, err := url.Parse(serverURL)
+	cfg := defaultConfig()
+	if *configPath != "" {
+		loaded, err := Load(*configPath)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		proxy := httputil.NewSingleHostReverseProxy(url)
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Printf("Error: %v", err)
-			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		cfg = loaded
+	}
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = ":8080"
+	}
+	if *certPath != "" || *keyPath != "" {
+		if cfg.TLS == nil {
+			cfg.TLS = &TLSConfig{}
+		}
+		if *certPath != "" {
+			cfg.TLS.CertFile = *certPath
 		}
+		if *keyPath != "" {
+			cfg.TLS.KeyFile = *keyPath
+		}
+	}
 
-		lb.backends = append(lb.backends, &Backend{
-			URL:          url,
-			Alive:        true,
-			ReverseProxy: proxy,
-		})
+	cookieSecret := make([]byte, 32)
+	if _, err := rand.Read(cookieSecret); err != nil {
+		log.Fatal(err)
+	}
 
-		log.Printf("Configured backend: %s", url)
+	lb := &LoadBalancer{cookieSecret: cookieSecret}
+	if err := lb.applyConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+	for _, b := range lb.backends {
+		logger.Info("configured backend", "backend", b.URL.String())
 	}
 
 	// Initial health check
 	lb.HealthCheck()
 
 	// Start periodic health check
-	go lb.HealthCheckPeriodically(time.Minute)
+	interval := time.Duration(cfg.HealthCheck.Interval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go lb.HealthCheckPeriodically(interval)
+
+	// Reload backends, strategy, and persistence on SIGHUP without
+	// dropping in-flight connections.
+	if *configPath != "" {
+		go lb.WatchReload(*configPath)
+	}
+
+	// Start the admin server, exposing /metrics on its own listener so it
+	// stays reachable even if the front-end listener is saturated.
+	if cfg.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metricsHandler())
+		adminServer := http.Server{Addr: cfg.AdminAddr, Handler: adminMux}
+		go func() {
+			logger.Info("admin server started", "addr", cfg.AdminAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("admin server failed", "error", err.Error())
+			}
+		}()
+	}
 
 	// Start server
 	server := http.Server{
-		Addr:    fmt.Sprintf(":%d", *port),
-		Handler: &lb,
+		Addr:    cfg.ListenAddr,
+		Handler: loggingMiddleware(lb),
 	}
 
-	log.Printf("Load Balancer started at: %d\n", *port)
+	if cfg.TLS == nil {
+		logger.Info("load balancer started", "addr", cfg.ListenAddr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	tlsConfig, acmeManager, err := buildServerTLSConfig(cfg.TLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.TLSConfig = tlsConfig
+
+	if cfg.TLS.HTTPRedirectAddr != "" {
+		redirectHandler := http.Handler(http.HandlerFunc(redirectToHTTPS))
+		if acmeManager != nil {
+			// Let the ACME manager answer HTTP-01 challenges itself;
+			// everything else still redirects to HTTPS.
+			redirectHandler = acmeManager.HTTPHandler(redirectHandler)
+		}
+		redirectServer := http.Server{Addr: cfg.TLS.HTTPRedirectAddr, Handler: redirectHandler}
+		go func() {
+			logger.Info("https redirect listener started", "addr", cfg.TLS.HTTPRedirectAddr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("https redirect listener failed", "error", err.Error())
+			}
+		}()
+	}
 
-	if err := server.ListenAndServe(); err != nil {
+	logger.Info("load balancer started", "addr", cfg.ListenAddr, "tls", true)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry is a dedicated Prometheus registry rather than the global
+// default one, so /metrics only ever exposes rmlb's own series.
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rmlb_requests_total",
+		Help: "Total number of requests forwarded, by backend, response code, and method.",
+	}, []string{"backend", "code", "method"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rmlb_request_duration_seconds",
+		Help:    "Request latency as observed by the load balancer, by backend and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend", "method"})
+
+	backendUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rmlb_backend_up",
+		Help: "Whether the backend is currently considered alive (1) or dead (0).",
+	}, []string{"backend"})
+
+	activeConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rmlb_active_connections",
+		Help: "Number of in-flight requests currently forwarded to the backend.",
+	}, []string{"backend"})
+
+	backendErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rmlb_backend_errors_total",
+		Help: "Total number of forwarding errors observed for the backend.",
+	}, []string{"backend"})
+)
+
+func init() {
+	registry.MustRegister(requestsTotal, requestDuration, backendUp, activeConnections, backendErrorsTotal)
+}
+
+// metricsHandler serves the Prometheus exposition format for registry.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// setActiveConnections reflects a backend's current in-flight count into
+// the rmlb_active_connections gauge.
+func setActiveConnections(host string, count int64) {
+	activeConnections.WithLabelValues(host).Set(float64(count))
+}
+
+// setBackendUp reflects a backend's alive state into the rmlb_backend_up
+// gauge.
+func setBackendUp(host string, alive bool) {
+	value := 0.0
+	if alive {
+		value = 1.0
+	}
+	backendUp.WithLabelValues(host).Set(value)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Persistence pins a client to a backend across requests, falling back to
+// the load balancer's Strategy when no pinned backend is available or it
+// is no longer alive.
+type Persistence interface {
+	// Get returns the backend this request should be pinned to, or nil if
+	// there is no pin (or the pinned backend is dead).
+	Get(r *http.Request, backends []*Backend) *Backend
+	// Assign records the chosen backend for future requests from the same
+	// client, e.g. by setting a cookie on the response.
+	Assign(w http.ResponseWriter, r *http.Request, backend *Backend)
+}
+
+// ================================== SOURCE IP (HRW) =============================== ///
+
+// SourceIPPersistence pins a client to a backend by hashing its source IP
+// using rendezvous (highest random weight) hashing, so that adding or
+// removing a backend only remaps roughly 1/N of clients.
+type SourceIPPersistence struct {
+	// TrustedProxies is the set of peer IPs allowed to supply a client IP
+	// via X-Forwarded-For. If empty, X-Forwarded-For is never trusted.
+	TrustedProxies []net.IP
+}
+
+// NewSourceIPPersistence creates a SourceIPPersistence trusting the given
+// proxy IPs to set X-Forwarded-For.
+func NewSourceIPPersistence(trustedProxies []net.IP) *SourceIPPersistence {
+	return &SourceIPPersistence{TrustedProxies: trustedProxies}
+}
+
+// Get returns the alive backend with the highest rendezvous weight for the
+// request's client IP.
+func (p *SourceIPPersistence) Get(r *http.Request, backends []*Backend) *Backend {
+	clientIP := p.clientIP(r)
+	if clientIP == "" {
+		return nil
+	}
+
+	var best *Backend
+	var bestWeight uint32
+	for _, b := range backends {
+		if !b.IsAlive() || !b.HasCapacity() {
+			continue
+		}
+		weight := rendezvousWeight(clientIP, b.URL.Host)
+		if best == nil || weight > bestWeight {
+			best = b
+			bestWeight = weight
+		}
+	}
+	return best
+}
+
+// Assign is a no-op for source-IP persistence: the mapping is recomputed
+// deterministically from the client IP on every request.
+func (p *SourceIPPersistence) Assign(w http.ResponseWriter, r *http.Request, backend *Backend) {}
+
+// clientIP returns the request's client IP, honoring X-Forwarded-For only
+// when the immediate peer is a trusted proxy.
+func (p *SourceIPPersistence) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if p.isTrustedProxy(host) {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			return strings.TrimSpace(parts[0])
+		}
+	}
+
+	return host
+}
+
+func (p *SourceIPPersistence) isTrustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, trusted := range p.TrustedProxies {
+		if trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rendezvousWeight computes the HRW weight of a (client, backend) pair.
+func rendezvousWeight(clientKey, backendKey string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(clientKey))
+	h.Write([]byte("|"))
+	h.Write([]byte(backendKey))
+	return h.Sum32()
+}
+
+// ================================== COOKIE =============================== ///
+
+const stickyCookieName = "rmlb_backend"
+
+// CookiePersistence pins a client to a backend via an opaque, HMAC-signed
+// cookie that encodes the backend's host.
+type CookiePersistence struct {
+	secret []byte
+	maxAge time.Duration
+}
+
+// NewCookiePersistence creates a CookiePersistence signing tokens with secret.
+func NewCookiePersistence(secret []byte, maxAge time.Duration) *CookiePersistence {
+	return &CookiePersistence{secret: secret, maxAge: maxAge}
+}
+
+// Get parses the sticky cookie, verifies its signature, and returns the
+// alive backend it names, or nil if the cookie is absent, invalid, or the
+// backend it names is dead.
+func (p *CookiePersistence) Get(r *http.Request, backends []*Backend) *Backend {
+	c, err := r.Cookie(stickyCookieName)
+	if err != nil {
+		return nil
+	}
+
+	host, ok := p.verify(c.Value)
+	if !ok {
+		return nil
+	}
+
+	for _, b := range backends {
+		if b.URL.Host == host && b.IsAlive() && b.HasCapacity() {
+			return b
+		}
+	}
+	return nil
+}
+
+// Assign sets the sticky cookie to the chosen backend.
+func (p *CookiePersistence) Assign(w http.ResponseWriter, r *http.Request, backend *Backend) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stickyCookieName,
+		Value:    p.sign(backend.URL.Host),
+		Path:     "/",
+		MaxAge:   int(p.maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign encodes host and an HMAC-SHA256 tag over it into an opaque token.
+func (p *CookiePersistence) sign(host string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(host))
+	tag := mac.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString([]byte(host)) + "." + base64.RawURLEncoding.EncodeToString(tag)
+}
+
+// verify decodes a token produced by sign and checks its HMAC tag.
+func (p *CookiePersistence) verify(token string) (host string, ok bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	hostBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(hostBytes)
+	expected := mac.Sum(nil)
+	if !hmac.Equal(tag, expected) {
+		return "", false
+	}
+
+	return string(hostBytes), true
+}
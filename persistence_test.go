@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSourceIPPersistenceStickyForSameClient(t *testing.T) {
+	a := testBackend(t, "a", 0, true)
+	b := testBackend(t, "b", 0, true)
+	backends := []*Backend{a, b}
+	p := NewSourceIPPersistence(nil)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.5:12345"
+
+	first := p.Get(r, backends)
+	if first == nil {
+		t.Fatal("Get() = nil, want a backend")
+	}
+	for i := 0; i < 5; i++ {
+		got := p.Get(r, backends)
+		if got != first {
+			t.Fatalf("Get() = %v on repeat call, want stable pick %v", got, first)
+		}
+	}
+}
+
+func TestSourceIPPersistenceSkipsDeadAndFullBackends(t *testing.T) {
+	dead := testBackend(t, "dead", 0, false)
+	full := testBackend(t, "full", 0, true)
+	full.MaxConns = 1
+	full.ActiveConnections = 1
+	alive := testBackend(t, "alive", 0, true)
+
+	p := NewSourceIPPersistence(nil)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.5:12345"
+
+	got := p.Get(r, []*Backend{dead, full, alive})
+	if got != alive {
+		t.Fatalf("Get() = %v, want the only selectable backend %v", got, alive)
+	}
+}
+
+func TestSourceIPPersistenceHonorsTrustedProxy(t *testing.T) {
+	p := NewSourceIPPersistence([]net.IP{net.ParseIP("10.0.0.1")})
+
+	trusted := httptest.NewRequest("GET", "/", nil)
+	trusted.RemoteAddr = "10.0.0.1:9999"
+	trusted.Header.Set("X-Forwarded-For", "198.51.100.9")
+
+	untrusted := httptest.NewRequest("GET", "/", nil)
+	untrusted.RemoteAddr = "10.0.0.1:9999"
+
+	if got := p.clientIP(trusted); got != "198.51.100.9" {
+		t.Fatalf("clientIP() from trusted proxy = %q, want forwarded IP", got)
+	}
+	if got := p.clientIP(untrusted); got != "10.0.0.1" {
+		t.Fatalf("clientIP() with no X-Forwarded-For = %q, want peer IP", got)
+	}
+
+	other := httptest.NewRequest("GET", "/", nil)
+	other.RemoteAddr = "198.51.100.1:9999"
+	other.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if got := p.clientIP(other); got != "198.51.100.1" {
+		t.Fatalf("clientIP() from untrusted peer = %q, want peer IP, not forwarded header", got)
+	}
+}
+
+func TestSourceIPPersistenceNoClientIP(t *testing.T) {
+	p := NewSourceIPPersistence(nil)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = ""
+	backends := []*Backend{testBackend(t, "a", 0, true)}
+	// An empty RemoteAddr still yields a (empty) host string via
+	// SplitHostPort's fallback, so Get should still return a pin; this
+	// test only guards against a panic on malformed RemoteAddr.
+	_ = p.Get(r, backends)
+}
+
+func TestCookiePersistenceRoundTrip(t *testing.T) {
+	p := NewCookiePersistence([]byte("secret"), time.Hour)
+	backend := testBackend(t, "backend-a", 0, true)
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	p.Assign(rec, r, backend)
+
+	resp := rec.Result()
+	cookies := resp.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Assign() set %d cookies, want 1", len(cookies))
+	}
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.AddCookie(cookies[0])
+
+	got := p.Get(r2, []*Backend{backend})
+	if got != backend {
+		t.Fatalf("Get() = %v, want %v", got, backend)
+	}
+}
+
+func TestCookiePersistenceRejectsTamperedCookie(t *testing.T) {
+	p := NewCookiePersistence([]byte("secret"), time.Hour)
+	backend := testBackend(t, "backend-a", 0, true)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: stickyCookieName, Value: p.sign("backend-a") + "tampered"})
+
+	if got := p.Get(r, []*Backend{backend}); got != nil {
+		t.Fatalf("Get() with tampered cookie = %v, want nil", got)
+	}
+}
+
+func TestCookiePersistenceDifferentSecretFailsVerification(t *testing.T) {
+	signer := NewCookiePersistence([]byte("secret-a"), time.Hour)
+	verifier := NewCookiePersistence([]byte("secret-b"), time.Hour)
+	backend := testBackend(t, "backend-a", 0, true)
+
+	rec := httptest.NewRecorder()
+	signer.Assign(rec, httptest.NewRequest("GET", "/", nil), backend)
+	cookie := rec.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	if got := verifier.Get(r, []*Backend{backend}); got != nil {
+		t.Fatalf("Get() across secrets = %v, want nil", got)
+	}
+}
+
+func TestCookiePersistenceSkipsDeadOrFullBackend(t *testing.T) {
+	p := NewCookiePersistence([]byte("secret"), time.Hour)
+	dead := testBackend(t, "backend-a", 0, false)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: stickyCookieName, Value: p.sign("backend-a")})
+
+	if got := p.Get(r, []*Backend{dead}); got != nil {
+		t.Fatalf("Get() for a dead pinned backend = %v, want nil", got)
+	}
+}
+
+func TestCookiePersistenceNoCookie(t *testing.T) {
+	p := NewCookiePersistence([]byte("secret"), time.Hour)
+	backend := testBackend(t, "backend-a", 0, true)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if got := p.Get(r, []*Backend{backend}); got != nil {
+		t.Fatalf("Get() with no cookie = %v, want nil", got)
+	}
+}
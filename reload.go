@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// buildBackends creates a *Backend (with its own ReverseProxy) for every
+// entry in cfg.Backends.
+func buildBackends(cfg *Config) ([]*Backend, error) {
+	policy := buildRetryPolicy(cfg)
+
+	backends := make([]*Backend, 0, len(cfg.Backends))
+	for _, bc := range cfg.Backends {
+		u, err := url.Parse(bc.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing backend URL %q: %w", bc.URL, err)
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		transport, err := buildBackendTransport(bc.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("backend %q: %w", bc.URL, err)
+		}
+
+		backend := &Backend{
+			URL:                  u,
+			Weight:               bc.Weight,
+			ReverseProxy:         proxy,
+			HealthCheckPath:      bc.HealthCheckPath,
+			MaxConns:             bc.MaxConns,
+			RiseThreshold:        cfg.HealthCheck.Rise,
+			FallThreshold:        cfg.HealthCheck.Fall,
+			PassiveFailThreshold: cfg.HealthCheck.PassiveFailThreshold,
+		}
+		// A nil *http.Transport must not be assigned to an interface
+		// field: doing so wraps it in a non-nil http.RoundTripper that
+		// panics on first use instead of falling back to the default
+		// transport.
+		if transport != nil {
+			proxy.Transport = transport
+			backend.Transport = transport
+		}
+
+		if cfg.CircuitBreaker.WindowSize > 0 {
+			backend.breaker = newCircuitBreaker(
+				cfg.CircuitBreaker.WindowSize,
+				cfg.CircuitBreaker.ErrorThreshold,
+				time.Duration(cfg.CircuitBreaker.Cooldown),
+			)
+		}
+
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("backend request failed", "backend", backend.URL.String(), "error", err.Error())
+			backend.recordPassiveFailure()
+			backend.recordRequestResult(false)
+			if outcome, ok := r.Context().Value(outcomeKey).(*proxyOutcome); ok && outcome != nil {
+				outcome.err = err
+			}
+		}
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			attempt, _ := resp.Request.Context().Value(attemptKey).(int)
+			if policy.isRetryableStatus(resp.Request.Method, resp.StatusCode) && attempt < policy.attempts()-1 {
+				// Don't record the result here: returning an error makes
+				// ReverseProxy call ErrorHandler with the same failure,
+				// which records it once for us. Recording it here too
+				// would double-count every retryable failure.
+				return fmt.Errorf("retryable upstream status %d", resp.StatusCode)
+			}
+			backend.recordRequestResult(resp.StatusCode < http.StatusInternalServerError)
+			return nil
+		}
+
+		backends = append(backends, backend)
+	}
+	return backends, nil
+}
+
+// buildRetryPolicy creates the retryPolicy described by cfg.Retry.
+func buildRetryPolicy(cfg *Config) *retryPolicy {
+	statuses := make(map[int]bool, len(cfg.Retry.RetryableStatuses))
+	for _, code := range cfg.Retry.RetryableStatuses {
+		statuses[code] = true
+	}
+	maxBuffer := cfg.Retry.MaxBufferBytes
+	if maxBuffer <= 0 {
+		maxBuffer = 1 << 20
+	}
+	return &retryPolicy{
+		MaxAttempts:       cfg.Retry.MaxAttempts,
+		RetryableStatuses: statuses,
+		MaxBufferBytes:    maxBuffer,
+		PerAttemptTimeout: time.Duration(cfg.Retry.PerAttemptTimeout),
+	}
+}
+
+// buildHealthChecker creates the HealthChecker described by cfg.HealthCheck.
+func buildHealthChecker(cfg *Config) HealthChecker {
+	path := cfg.HealthCheck.Path
+	if path == "" {
+		path = "/"
+	}
+	timeout := time.Duration(cfg.HealthCheck.Timeout)
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return NewHTTPHealthChecker(path, timeout)
+}
+
+// applyConfig builds a new set of backends, strategy, persistence, and
+// health checker from cfg, health-checks any genuinely new backends before
+// they join rotation, and atomically swaps them into lb. Backends that
+// disappear from cfg are simply dropped from the new slice: in-flight
+// requests already hold their own *Backend reference via ServeHTTP's
+// closure over the reverse proxy, so they finish normally (drain) while
+// NextBackend stops selecting the removed backend immediately.
+func (lb *LoadBalancer) applyConfig(cfg *Config) error {
+	existing := make(map[string]*Backend, len(lb.backends))
+	lb.mux.RLock()
+	for _, b := range lb.backends {
+		existing[b.URL.String()] = b
+	}
+	lb.mux.RUnlock()
+
+	backends, err := buildBackends(cfg)
+	if err != nil {
+		return err
+	}
+
+	checker := buildHealthChecker(cfg)
+
+	for i, b := range backends {
+		if prev, ok := existing[b.URL.String()]; ok {
+			// Carry over the live health state of a backend that was
+			// already in rotation. Use the raw Alive flag, not IsAlive:
+			// IsAlive also reports true for a tripped backend that's
+			// merely probe-ready, which would hand the new backend (and
+			// its brand-new, closed breaker) a false Alive=true and
+			// silently skip the half-open probe the old breaker was
+			// waiting to run.
+			b.Alive = prev.rawAlive()
+			continue
+		}
+		// A genuinely new backend: health-check it before it joins
+		// rotation instead of waiting for the next periodic tick.
+		b.Alive = checker.Check(b)
+		backends[i] = b
+	}
+
+	strategy, err := newStrategy(cfg.Strategy, backends)
+	if err != nil {
+		return err
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	persistence, err := newPersistence(cfg.Persistence, trustedProxies, lb.cookieSecret)
+	if err != nil {
+		return err
+	}
+
+	retryPolicy := buildRetryPolicy(cfg)
+
+	lb.mux.Lock()
+	lb.backends = backends
+	lb.strategy = strategy
+	lb.persistence = persistence
+	lb.healthChecker = checker
+	lb.retryPolicy = retryPolicy
+	lb.mux.Unlock()
+
+	return nil
+}
+
+// Reload re-reads the config file at path and atomically applies it.
+func (lb *LoadBalancer) Reload(path string) error {
+	cfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+	return lb.applyConfig(cfg)
+}
+
+// WatchReload reloads the config file at path every time the process
+// receives SIGHUP, logging (but not exiting on) reload errors.
+func (lb *LoadBalancer) WatchReload(path string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		logger.Info("reloading config", "path", path)
+		if err := lb.Reload(path); err != nil {
+			logger.Error("config reload failed", "error", err.Error())
+			continue
+		}
+		logger.Info("config reloaded")
+	}
+}
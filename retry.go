@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// retryPolicy controls how ServeHTTP retries a forwarded request against a
+// different backend.
+type retryPolicy struct {
+	// MaxAttempts is the total number of backends tried, including the
+	// first. Values <= 1 disable retries.
+	MaxAttempts int
+	// RetryableStatuses are upstream response codes, for idempotent
+	// request methods only, that are retried against another backend.
+	RetryableStatuses map[int]bool
+	// MaxBufferBytes caps how much of a request body is buffered so it can
+	// be replayed on retry. Requests with larger or unbuffered bodies are
+	// only attempted once.
+	MaxBufferBytes int64
+	// PerAttemptTimeout bounds how long a single backend attempt may take.
+	// Zero means no per-attempt deadline.
+	PerAttemptTimeout time.Duration
+}
+
+// idempotentMethods are the request methods eligible for retry on an
+// upstream error; retrying POST/PATCH risks duplicating a side effect.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// bufferedBody reads and returns r's body as a reusable io.ReadSeeker, and
+// whether it was small enough to buffer (a nil body counts as buffered).
+func bufferedBody(r *http.Request, maxBytes int64) (io.ReadSeeker, bool) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil, true
+	}
+
+	limited := io.LimitReader(r.Body, maxBytes+1)
+	data, err := io.ReadAll(limited)
+	r.Body.Close()
+	if err != nil || int64(len(data)) > maxBytes {
+		return nil, false
+	}
+	return bytes.NewReader(data), true
+}
+
+// proxyOutcome carries the result of a single backend attempt back out of
+// the ReverseProxy's ErrorHandler/ModifyResponse hooks, which don't
+// otherwise have a return path to the caller.
+type proxyOutcome struct {
+	err error
+}
+
+type outcomeKeyType struct{}
+type attemptKeyType struct{}
+
+var outcomeKey outcomeKeyType
+var attemptKey attemptKeyType
+
+// withOutcome attaches a fresh proxyOutcome to ctx and returns both.
+func withOutcome(ctx context.Context) (context.Context, *proxyOutcome) {
+	outcome := &proxyOutcome{}
+	return context.WithValue(ctx, outcomeKey, outcome), outcome
+}
+
+// attemptRequest clones r for a single backend attempt, rewinding body to
+// the start when one was buffered.
+func attemptRequest(r *http.Request, ctx context.Context, body io.ReadSeeker) *http.Request {
+	clone := r.Clone(ctx)
+	if body != nil {
+		body.Seek(0, io.SeekStart)
+		clone.Body = io.NopCloser(body)
+	}
+	return clone
+}
+
+// isRetryableStatus reports whether code should be retried against another
+// backend for the given request method, per policy.
+func (p *retryPolicy) isRetryableStatus(method string, code int) bool {
+	return idempotentMethods[method] && p.RetryableStatuses[code]
+}
+
+// attempts returns how many backends should be tried, at least one.
+func (p *retryPolicy) attempts() int {
+	if p.MaxAttempts <= 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Strategy picks a backend to handle a request. Backends present as keys
+// in excluded (e.g. ones a retry already tried) must never be returned.
+type Strategy interface {
+	Pick(r *http.Request, excluded map[*Backend]bool) *Backend
+}
+
+// ================================== ROUND ROBIN =============================== ///
+
+// RoundRobinStrategy cycles through backends in order, skipping dead ones.
+type RoundRobinStrategy struct {
+	backends []*Backend
+	current  uint64
+}
+
+// NewRoundRobinStrategy creates a RoundRobinStrategy over backends.
+func NewRoundRobinStrategy(backends []*Backend) *RoundRobinStrategy {
+	return &RoundRobinStrategy{backends: backends}
+}
+
+// Pick returns the next alive, non-excluded, under-capacity backend in
+// round-robin order.
+func (s *RoundRobinStrategy) Pick(r *http.Request, excluded map[*Backend]bool) *Backend {
+	if len(s.backends) == 0 {
+		return nil
+	}
+	next := atomic.AddUint64(&s.current, uint64(1)) % uint64(len(s.backends))
+	for i := 0; i < len(s.backends); i++ {
+		idx := (int(next) + i) % len(s.backends)
+		b := s.backends[idx]
+		if b.IsAlive() && b.HasCapacity() && !excluded[b] {
+			return b
+		}
+	}
+	return nil
+}
+
+// ================================== WEIGHTED ROUND ROBIN =============================== ///
+
+// WeightedRoundRobinStrategy implements Nginx-style smooth weighted round-robin.
+type WeightedRoundRobinStrategy struct {
+	mux      sync.Mutex
+	backends []*Backend
+}
+
+// NewWeightedRoundRobinStrategy creates a WeightedRoundRobinStrategy over backends.
+func NewWeightedRoundRobinStrategy(backends []*Backend) *WeightedRoundRobinStrategy {
+	return &WeightedRoundRobinStrategy{backends: backends}
+}
+
+// Pick returns the alive, non-excluded, under-capacity backend with the
+// highest current weight, and rebalances weights so that selection
+// frequency matches each backend's configured Weight. Excluded or
+// over-capacity backends still participate in the weight bookkeeping (so
+// the distribution stays correct over time) but are never returned as the
+// winner.
+func (s *WeightedRoundRobinStrategy) Pick(r *http.Request, excluded map[*Backend]bool) *Backend {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var totalWeight int
+	var best *Backend
+	for _, b := range s.backends {
+		if !b.IsAlive() {
+			continue
+		}
+		weight := b.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+
+		b.mux.Lock()
+		b.currentWeight += weight
+		current := b.currentWeight
+		b.mux.Unlock()
+
+		if excluded[b] || !b.HasCapacity() {
+			continue
+		}
+		if best == nil || current > best.currentWeight {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	best.mux.Lock()
+	best.currentWeight -= totalWeight
+	best.mux.Unlock()
+
+	return best
+}
+
+// ================================== LEAST CONNECTIONS =============================== ///
+
+// LeastConnectionsStrategy picks the alive backend with the fewest active
+// connections, breaking ties with round-robin.
+type LeastConnectionsStrategy struct {
+	backends []*Backend
+
+	// tieBreak is a persistent round-robin counter shared across Pick
+	// calls, so that a sustained tie between two backends rotates between
+	// them instead of resolving to the same winner every time.
+	tieBreak uint64
+}
+
+// NewLeastConnectionsStrategy creates a LeastConnectionsStrategy over backends.
+func NewLeastConnectionsStrategy(backends []*Backend) *LeastConnectionsStrategy {
+	return &LeastConnectionsStrategy{backends: backends}
+}
+
+// Pick returns the alive, non-excluded, under-capacity backend with the
+// smallest ActiveConnections count.
+func (s *LeastConnectionsStrategy) Pick(r *http.Request, excluded map[*Backend]bool) *Backend {
+	var candidates []*Backend
+	min := int64(-1)
+	for _, b := range s.backends {
+		if !b.IsAlive() || excluded[b] || !b.HasCapacity() {
+			continue
+		}
+		conns := atomic.LoadInt64(&b.ActiveConnections)
+		switch {
+		case min == -1 || conns < min:
+			min = conns
+			candidates = candidates[:0]
+			candidates = append(candidates, b)
+		case conns == min:
+			candidates = append(candidates, b)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	default:
+		// Tie-break with round-robin among the least-loaded backends,
+		// using the persistent counter so repeated ties rotate instead
+		// of always resolving to the same candidate.
+		next := atomic.AddUint64(&s.tieBreak, 1) % uint64(len(candidates))
+		return candidates[next]
+	}
+}
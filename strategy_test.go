@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func testBackend(t *testing.T, host string, weight int, alive bool) *Backend {
+	t.Helper()
+	u, err := url.Parse("http://" + host)
+	if err != nil {
+		t.Fatalf("parsing test backend URL: %v", err)
+	}
+	b := &Backend{URL: u, Weight: weight, Alive: alive}
+	return b
+}
+
+func TestRoundRobinStrategySkipsDead(t *testing.T) {
+	alive := testBackend(t, "a", 0, true)
+	dead := testBackend(t, "b", 0, false)
+	s := NewRoundRobinStrategy([]*Backend{dead, alive})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 5; i++ {
+		got := s.Pick(req, nil)
+		if got != alive {
+			t.Fatalf("Pick() = %v, want the only alive backend %v", got, alive)
+		}
+	}
+}
+
+func TestRoundRobinStrategyCycles(t *testing.T) {
+	a := testBackend(t, "a", 0, true)
+	b := testBackend(t, "b", 0, true)
+	s := NewRoundRobinStrategy([]*Backend{a, b})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	seen := map[*Backend]int{}
+	for i := 0; i < 4; i++ {
+		seen[s.Pick(req, nil)]++
+	}
+	if seen[a] != 2 || seen[b] != 2 {
+		t.Fatalf("round-robin did not alternate evenly: %v", seen)
+	}
+}
+
+func TestRoundRobinStrategyExcluded(t *testing.T) {
+	a := testBackend(t, "a", 0, true)
+	b := testBackend(t, "b", 0, true)
+	s := NewRoundRobinStrategy([]*Backend{a, b})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	got := s.Pick(req, map[*Backend]bool{a: true})
+	if got != b {
+		t.Fatalf("Pick() with a excluded = %v, want b", got)
+	}
+}
+
+func TestRoundRobinStrategyNoBackends(t *testing.T) {
+	s := NewRoundRobinStrategy(nil)
+	if got := s.Pick(httptest.NewRequest("GET", "/", nil), nil); got != nil {
+		t.Fatalf("Pick() on empty strategy = %v, want nil", got)
+	}
+}
+
+func TestWeightedRoundRobinStrategyDistribution(t *testing.T) {
+	heavy := testBackend(t, "heavy", 3, true)
+	light := testBackend(t, "light", 1, true)
+	s := NewWeightedRoundRobinStrategy([]*Backend{heavy, light})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	counts := map[*Backend]int{}
+	const rounds = 40
+	for i := 0; i < rounds; i++ {
+		counts[s.Pick(req, nil)]++
+	}
+	// Over a multiple of the total weight (4), heavy should land close to
+	// 3x as often as light.
+	if counts[heavy] <= counts[light] {
+		t.Fatalf("expected heavy backend to be picked more often: %v", counts)
+	}
+	if counts[heavy]+counts[light] != rounds {
+		t.Fatalf("picks don't add up: %v", counts)
+	}
+}
+
+func TestWeightedRoundRobinStrategyExcluded(t *testing.T) {
+	a := testBackend(t, "a", 1, true)
+	b := testBackend(t, "b", 1, true)
+	s := NewWeightedRoundRobinStrategy([]*Backend{a, b})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	for i := 0; i < 5; i++ {
+		got := s.Pick(req, map[*Backend]bool{a: true})
+		if got != b {
+			t.Fatalf("Pick() with a excluded = %v, want b", got)
+		}
+	}
+}
+
+func TestLeastConnectionsStrategyPicksFewest(t *testing.T) {
+	busy := testBackend(t, "busy", 0, true)
+	busy.ActiveConnections = 5
+	idle := testBackend(t, "idle", 0, true)
+	s := NewLeastConnectionsStrategy([]*Backend{busy, idle})
+
+	got := s.Pick(httptest.NewRequest("GET", "/", nil), nil)
+	if got != idle {
+		t.Fatalf("Pick() = %v, want the idle backend", got)
+	}
+}
+
+func TestLeastConnectionsStrategyTieBreak(t *testing.T) {
+	a := testBackend(t, "a", 0, true)
+	b := testBackend(t, "b", 0, true)
+	s := NewLeastConnectionsStrategy([]*Backend{a, b})
+	req := httptest.NewRequest("GET", "/", nil)
+
+	got := s.Pick(req, nil)
+	if got != a && got != b {
+		t.Fatalf("Pick() = %v, want one of the tied backends", got)
+	}
+}
+
+func TestLeastConnectionsStrategyExcluded(t *testing.T) {
+	a := testBackend(t, "a", 0, true)
+	b := testBackend(t, "b", 0, true)
+	b.ActiveConnections = 1
+	s := NewLeastConnectionsStrategy([]*Backend{a, b})
+
+	got := s.Pick(httptest.NewRequest("GET", "/", nil), map[*Backend]bool{a: true})
+	if got != b {
+		t.Fatalf("Pick() with the least-loaded backend excluded = %v, want b", got)
+	}
+}
+
+func TestLeastConnectionsStrategyRespectsMaxConns(t *testing.T) {
+	full := testBackend(t, "full", 0, true)
+	full.MaxConns = 1
+	full.ActiveConnections = 1
+	idle := testBackend(t, "idle", 0, true)
+	idle.MaxConns = 5
+	idle.ActiveConnections = 2
+	s := NewLeastConnectionsStrategy([]*Backend{full, idle})
+
+	got := s.Pick(httptest.NewRequest("GET", "/", nil), nil)
+	if got != idle {
+		t.Fatalf("Pick() = %v, want the backend under its connection cap", got)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// buildServerTLSConfig builds the *tls.Config the front-end listener
+// terminates TLS with, from either a static cert/key pair or an AutoCert
+// host allow-list. HTTP/2 is enabled by including "h2" in NextProtos,
+// which is also what signals http.Server to negotiate it. The returned
+// *autocert.Manager is non-nil only when AutoCert is configured, so the
+// caller can route ACME HTTP-01 challenges to it on the redirect listener.
+func buildServerTLSConfig(cfg *TLSConfig) (*tls.Config, *autocert.Manager, error) {
+	if cfg.AutoCert != nil {
+		if len(cfg.AutoCert.Hosts) == 0 {
+			return nil, nil, fmt.Errorf("tls.auto_cert requires at least one host")
+		}
+		cacheDir := cfg.AutoCert.CacheDir
+		if cacheDir == "" {
+			cacheDir = "autocert-cache"
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.AutoCert.Hosts...),
+		}
+		tlsCfg := manager.TLSConfig()
+		tlsCfg.NextProtos = append([]string{"h2"}, tlsCfg.NextProtos...)
+		return tlsCfg, manager, nil
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, nil, fmt.Errorf("tls requires either auto_cert or both cert_file and key_file")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil, nil
+}
+
+// redirectToHTTPS is the handler for the plain-HTTP listener started
+// alongside a TLS front end: it sends every request to the same host over
+// HTTPS.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	target := "https://" + r.Host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// buildBackendTransport builds the http.Transport a Backend's ReverseProxy
+// uses to reach it, applying custom root CAs, InsecureSkipVerify, and
+// client certs (mTLS) described by cfg. A nil cfg yields nil, so the
+// ReverseProxy falls back to http.DefaultTransport.
+func buildBackendTransport(cfg *BackendTLSConfig) (*http.Transport, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading backend CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading backend client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return transport, nil
+}